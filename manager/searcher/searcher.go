@@ -22,10 +22,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	stdmath "math"
 	"net"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
+	"github.com/cespare/xxhash/v2"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/mitchellh/mapstructure"
 	"github.com/yl2chen/cidranger"
 
@@ -46,12 +53,47 @@ const (
 	ConditionLocation = "location"
 )
 
+const (
+	// LabelIP is the reserved label key under which the dfdaemon ip is merged
+	// into the labels map passed to selector matching.
+	LabelIP = "__ip__"
+
+	// LabelHostname is the reserved label key under which the dfdaemon hostname
+	// is merged into the labels map passed to selector matching.
+	LabelHostname = "__hostname__"
+)
+
+// Operator is the relation between a match expression's key and its values.
+type Operator string
+
+const (
+	// OperatorIn requires the label value to be one of the expression's values.
+	OperatorIn Operator = "In"
+
+	// OperatorNotIn requires the label value to not be one of the expression's values.
+	OperatorNotIn Operator = "NotIn"
+
+	// OperatorExists requires the label key to exist, regardless of its value.
+	OperatorExists Operator = "Exists"
+
+	// OperatorDoesNotExist requires the label key to not exist.
+	OperatorDoesNotExist Operator = "DoesNotExist"
+
+	// OperatorMatches requires the label value to match an anchored RE2 regexp
+	// built from the expression's single value.
+	OperatorMatches Operator = "Matches"
+
+	// OperatorDoesNotMatch requires the label value to not match an anchored
+	// RE2 regexp built from the expression's single value.
+	OperatorDoesNotMatch Operator = "DoesNotMatch"
+)
+
 const (
 	// securityDomainAffinityWeight is security domain affinity weight.
-	securityDomainAffinityWeight float64 = 0.4
+	securityDomainAffinityWeight float64 = 0.3
 
 	// cidrAffinityWeight is CIDR affinity weight.
-	cidrAffinityWeight float64 = 0.3
+	cidrAffinityWeight float64 = 0.2
 
 	// idcAffinityWeight is IDC affinity weight.
 	idcAffinityWeight float64 = 0.15
@@ -59,6 +101,9 @@ const (
 	// locationAffinityWeight is location affinity weight.
 	locationAffinityWeight = 0.1
 
+	// labelSelectorAffinityWeight is label selector affinity weight.
+	labelSelectorAffinityWeight float64 = 0.2
+
 	// clusterTypeWeight is cluster type weight.
 	clusterTypeWeight float64 = 0.05
 )
@@ -76,16 +121,529 @@ const (
 	maxElementLen = 5
 )
 
+const (
+	// geoLocationPrefix prefixes a location condition that carries
+	// coordinates instead of "|"-delimited string tokens, e.g. "geo:37.3,-122.0".
+	geoLocationPrefix = "geo:"
+
+	// earthRadiusKm is the mean radius of the Earth used by the haversine
+	// distance calculation.
+	earthRadiusKm = 6371.0
+)
+
+// maxGeoDistanceKm is the distance beyond which two geo-coordinates score no
+// location affinity at all, stored in an atomic.Value since
+// SetMaxGeoDistanceKm and calculateLocationAffinityScore can race across
+// concurrent Evaluate calls and a config hot-reload.
+var maxGeoDistanceKm atomic.Value
+
+func init() {
+	maxGeoDistanceKm.Store(float64(10000))
+}
+
+// MaxGeoDistanceKm returns the distance beyond which two geo-coordinates
+// score no location affinity at all.
+func MaxGeoDistanceKm() float64 {
+	return maxGeoDistanceKm.Load().(float64)
+}
+
+// SetMaxGeoDistanceKm installs the distance beyond which two geo-coordinates
+// score no location affinity at all. Deployments may lower or raise it to
+// match the scale they expect clients and clusters to be distributed over.
+func SetMaxGeoDistanceKm(km float64) {
+	maxGeoDistanceKm.Store(km)
+}
+
+// clusterCacheSize is the maximum number of scheduler clusters whose decoded
+// Scopes and CIDR ranger are kept in clusterCache at once.
+const clusterCacheSize = 10000
+
 // Scheduler cluster scopes.
 type Scopes struct {
-	IDC      string   `mapstructure:"idc"`
-	Location string   `mapstructure:"location"`
-	CIDRs    []string `mapstructure:"cidrs"`
+	IDC       string            `mapstructure:"idc"`
+	Location  string            `mapstructure:"location"`
+	CIDRs     []string          `mapstructure:"cidrs"`
+	Selectors []MatchExpression `mapstructure:"selectors"`
+
+	// Latitude and Longitude are the optional coordinates of the scheduler
+	// cluster, used in place of the string-token Location score when the
+	// dfdaemon also supplies coordinates. They default to NaN (set by
+	// clusterCache.get before decoding) so that a cluster genuinely located
+	// at (0, 0) is distinguishable from one that never configured
+	// coordinates at all.
+	Latitude  float64 `mapstructure:"latitude"`
+	Longitude float64 `mapstructure:"longitude"`
+}
+
+// hasCoordinates reports whether scopes carries a usable geo-coordinate.
+func (s Scopes) hasCoordinates() bool {
+	return !stdmath.IsNaN(s.Latitude) && !stdmath.IsNaN(s.Longitude)
+}
+
+// MatchExpression is a Prometheus-style label selector expression used to
+// match a dfdaemon's labels against a scheduler cluster's scopes.
+type MatchExpression struct {
+	// Key is the label key to match.
+	Key string `mapstructure:"key"`
+
+	// Operator is the relation applied between Key's value and Values.
+	Operator Operator `mapstructure:"op"`
+
+	// Values is the set of values compared against the label value. For
+	// OperatorMatches and OperatorDoesNotMatch only the first value is used,
+	// interpreted as an anchored RE2 regexp.
+	Values []string `mapstructure:"values"`
+
+	// Weight is the contribution of this expression towards the label
+	// selector affinity score when it matches. Defaults to 1 when zero.
+	Weight float64 `mapstructure:"weight"`
+
+	// regex is the compiled regexp for OperatorMatches and
+	// OperatorDoesNotMatch, compiled once when the expression is parsed.
+	regex *regexp.Regexp
+}
+
+// compile parses and caches the anchored RE2 regexp used by OperatorMatches
+// and OperatorDoesNotMatch. It is a no-op for other operators, and for an
+// expression that was already compiled. Outside tests it is only called
+// through compileSelectors from clusterCache.get, which compiles every
+// selector exactly once, right after decoding a cluster's
+// Scopes and before the entry is shared via the LRU, so that the concurrent
+// callers FindSchedulerClusters/FilterSchedulerClusters fan out to never
+// race on the same *MatchExpression.regex.
+func (m *MatchExpression) compile() error {
+	if m.Operator != OperatorMatches && m.Operator != OperatorDoesNotMatch {
+		return nil
+	}
+
+	if m.regex != nil {
+		return nil
+	}
+
+	if len(m.Values) == 0 {
+		return fmt.Errorf("selector %s requires a regexp value", m.Key)
+	}
+
+	regex, err := regexp.Compile("^(?:" + m.Values[0] + ")$")
+	if err != nil {
+		return fmt.Errorf("selector %s has invalid regexp: %w", m.Key, err)
+	}
+
+	m.regex = regex
+	return nil
+}
+
+// weight returns the configured weight, defaulting to 1 when unset.
+func (m *MatchExpression) weight() float64 {
+	if m.Weight == 0 {
+		return 1
+	}
+
+	return m.Weight
+}
+
+// match reports whether labels satisfy this expression.
+func (m *MatchExpression) match(labels map[string]string) bool {
+	value, ok := labels[m.Key]
+	switch m.Operator {
+	case OperatorIn:
+		if !ok {
+			return false
+		}
+
+		for _, v := range m.Values {
+			if value == v {
+				return true
+			}
+		}
+
+		return false
+	case OperatorNotIn:
+		if !ok {
+			return true
+		}
+
+		for _, v := range m.Values {
+			if value == v {
+				return false
+			}
+		}
+
+		return true
+	case OperatorExists:
+		return ok
+	case OperatorDoesNotExist:
+		return !ok
+	case OperatorMatches:
+		return ok && m.regex != nil && m.regex.MatchString(value)
+	case OperatorDoesNotMatch:
+		if !ok {
+			return true
+		}
+
+		return m.regex == nil || !m.regex.MatchString(value)
+	default:
+		logger.Errorf("selector %s has unknown operator %q", m.Key, m.Operator)
+		return false
+	}
+}
+
+// filterSelectors returns only the explicitly configured Selectors, already
+// compiled by clusterCache.get. It never falls back to synthesizing
+// expressions from the legacy IDC/Location fields: those are scored
+// separately by calculateIDCAffinityScore/calculateLocationAffinityScore, and
+// those scores already cover every cluster that predates Selectors, so a
+// fallback here would either reject clusters that matched before Selectors
+// existed (filterSchedulerClusters) or double-count the same match twice
+// (calculateLabelSelectorAffinityScore).
+func (s Scopes) filterSelectors() []MatchExpression {
+	return s.Selectors
+}
+
+// compileSelectors compiles the regexps of OperatorMatches/OperatorDoesNotMatch
+// expressions, logging any that fail to compile. A failed expression stays in
+// the returned list with a nil regexp, so OperatorMatches never matches and
+// OperatorDoesNotMatch always matches for it. Called exactly
+// once per decoded Scopes, by clusterCache.get, before the entry is shared
+// with concurrent callers.
+func compileSelectors(selectors []MatchExpression) []MatchExpression {
+	for i := range selectors {
+		if err := selectors[i].compile(); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	return selectors
+}
+
+// mergeLabels merges ip, hostname and conditions into labels under the
+// reserved __ip__ and __hostname__ keys, giving conditions precedence over
+// explicitly provided labels for overlapping keys.
+func mergeLabels(ip, hostname string, conditions, labels map[string]string) map[string]string {
+	merged := make(map[string]string, len(labels)+len(conditions)+2)
+	for k, v := range labels {
+		merged[k] = v
+	}
+
+	if ip != "" {
+		merged[LabelIP] = ip
+	}
+
+	if hostname != "" {
+		merged[LabelHostname] = hostname
+	}
+
+	for k, v := range conditions {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// GeoResolver resolves a dfdaemon's ip to a coordinate, so the default
+// searcher can enrich the client side of the location affinity score when
+// the dfdaemon reports an ip but no location. The default resolver is a
+// no-op; deployments can plug in a MaxMind-style implementation with
+// SetGeoResolver.
+type GeoResolver interface {
+	// Resolve returns the coordinate for ip, and false when it cannot be
+	// resolved.
+	Resolve(ip string) (latitude, longitude float64, ok bool)
+}
+
+// noopGeoResolver never resolves a coordinate.
+type noopGeoResolver struct{}
+
+func (noopGeoResolver) Resolve(string) (float64, float64, bool) {
+	return 0, 0, false
+}
+
+// geoResolverBox wraps a GeoResolver so it can be swapped as a single
+// immutable value in geoResolverState: atomic.Value requires every Store to
+// use the same concrete type, which the GeoResolver interface alone cannot
+// guarantee across different implementations.
+type geoResolverBox struct {
+	resolver GeoResolver
+}
+
+// geoResolverState holds the package-wide GeoResolver used to enrich the
+// client side of the location affinity score. Defaults to a no-op.
+// SetGeoResolver and calculateLocationAffinityScore can race across
+// concurrent Evaluate calls and a config hot-reload, so it is swapped
+// atomically rather than through a bare package var.
+var geoResolverState atomic.Value
+
+func init() {
+	geoResolverState.Store(&geoResolverBox{resolver: noopGeoResolver{}})
+}
+
+// currentGeoResolver returns the installed GeoResolver.
+func currentGeoResolver() GeoResolver {
+	return geoResolverState.Load().(*geoResolverBox).resolver
+}
+
+// SetGeoResolver installs the GeoResolver used to resolve a dfdaemon's ip to
+// a coordinate when its location condition is empty. Passing nil restores
+// the no-op default.
+func SetGeoResolver(resolver GeoResolver) {
+	if resolver == nil {
+		resolver = noopGeoResolver{}
+	}
+
+	geoResolverState.Store(&geoResolverBox{resolver: resolver})
+}
+
+// parseGeoLocation parses a "geo:<lat>,<lon>" location condition, returning
+// ok=false for any other form.
+func parseGeoLocation(location string) (latitude, longitude float64, ok bool) {
+	rest, found := strings.CutPrefix(location, geoLocationPrefix)
+	if !found {
+		return 0, 0, false
+	}
+
+	lat, lon, found := strings.Cut(rest, ",")
+	if !found {
+		return 0, 0, false
+	}
+
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	longitude, err = strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return latitude, longitude, true
+}
+
+// haversineKm returns the great-circle distance between two coordinates in kilometers.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * stdmath.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := stdmath.Sin(dLat/2)*stdmath.Sin(dLat/2) +
+		stdmath.Cos(toRadians(lat1))*stdmath.Cos(toRadians(lat2))*stdmath.Sin(dLon/2)*stdmath.Sin(dLon/2)
+	c := 2 * stdmath.Atan2(stdmath.Sqrt(a), stdmath.Sqrt(1-a))
+	return earthRadiusKm * c
+}
+
+// calculateLocationAffinityScore 0.0~1.0 larger and better. When both the
+// dfdaemon and the scheduler cluster provide coordinates, the score is based
+// on haversine distance; otherwise it falls back to the string-token score.
+// The dfdaemon's coordinate may come from an explicit "geo:" location
+// condition, or from the installed GeoResolver when location is empty but ip
+// is known.
+func calculateLocationAffinityScore(ip, location string, scopes Scopes) float64 {
+	dstLatitude, dstLongitude, ok := parseGeoLocation(location)
+	if !ok && location == "" && ip != "" {
+		dstLatitude, dstLongitude, ok = currentGeoResolver().Resolve(ip)
+	}
+
+	if ok && scopes.hasCoordinates() {
+		maxDistance := MaxGeoDistanceKm()
+		if maxDistance <= 0 {
+			return minScore
+		}
+
+		distance := haversineKm(dstLatitude, dstLongitude, scopes.Latitude, scopes.Longitude)
+		return maxScore - stdmath.Min(distance/maxDistance, maxScore)
+	}
+
+	return calculateMultiElementAffinityScore(location, scopes.Location)
+}
+
+// clusterScope is a scheduler cluster's decoded Scopes plus its derived CIDR
+// ranger, memoized in clusterCache so that repeated lookups for the same
+// cluster avoid re-decoding Scopes and re-parsing its CIDRs.
+type clusterScope struct {
+	// version is a hash of the raw Scopes map this entry was built from, used
+	// to invalidate the entry when the scheduler cluster's Scopes change.
+	version uint64
+
+	scopes Scopes
+	ranger cidranger.Ranger
+}
+
+// clusterCache memoizes decoded Scopes and CIDR rangers per scheduler
+// cluster, keyed by the cluster's primary key (its Name).
+type clusterCache struct {
+	lru *lru.Cache
+}
+
+// globalClusterCache is shared by every searcher so that plugin
+// implementations reuse the same cache across calls.
+var globalClusterCache = newClusterCache()
+
+func newClusterCache() *clusterCache {
+	c, err := lru.New(clusterCacheSize)
+	if err != nil {
+		// Only returns an error for a non-positive size, which never happens
+		// for the constant above.
+		panic(err)
+	}
+
+	return &clusterCache{lru: c}
+}
+
+// hashScopes computes a version hash of the raw Scopes map so cache entries
+// can be invalidated when a scheduler cluster's Scopes are updated.
+func hashScopes(rawScopes map[string]interface{}) uint64 {
+	h := fnv.New64a()
+	keys := make([]string, 0, len(rawScopes))
+	for k := range rawScopes {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		fmt.Fprintf(h, "%v", rawScopes[k])
+		h.Write([]byte{0})
+	}
+
+	return h.Sum64()
+}
+
+// get returns the decoded Scopes and CIDR ranger for the cluster identified
+// by key, decoding rawScopes and building the ranger only when the cache is
+// missing an entry or rawScopes has changed since it was cached.
+func (c *clusterCache) get(key string, rawScopes map[string]interface{}) (Scopes, cidranger.Ranger, error) {
+	version := hashScopes(rawScopes)
+	if v, ok := c.lru.Get(key); ok {
+		if entry := v.(*clusterScope); entry.version == version {
+			return entry.scopes, entry.ranger, nil
+		}
+	}
+
+	// Latitude/Longitude default to NaN rather than the struct zero value, so
+	// that a rawScopes map without them decodes to "no coordinate" instead of
+	// (0, 0); mapstructure.Decode only overwrites fields present in the map.
+	scopes := Scopes{Latitude: stdmath.NaN(), Longitude: stdmath.NaN()}
+	if err := mapstructure.Decode(rawScopes, &scopes); err != nil {
+		return Scopes{}, nil, err
+	}
+
+	// Compile every selector's regexp here, once, before scopes is shared
+	// through the LRU: filterSelectors/Evaluate read scopes.Selectors
+	// concurrently across scheduling requests, and compiling lazily on each
+	// read would race on the same *MatchExpression.regex.
+	scopes.Selectors = compileSelectors(scopes.Selectors)
+
+	ranger := newCIDRRanger(scopes.CIDRs)
+	c.lru.Add(key, &clusterScope{version: version, scopes: scopes, ranger: ranger})
+	return scopes, ranger, nil
+}
+
+// newCIDRRanger builds a CIDR ranger from cidrs, skipping and logging any
+// entries that fail to parse.
+func newCIDRRanger(cidrs []string) cidranger.Ranger {
+	ranger := cidranger.NewPCTrieRanger()
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+
+		if err := ranger.Insert(cidranger.NewBasicRangerEntry(*network)); err != nil {
+			logger.Error(err)
+			continue
+		}
+	}
+
+	return ranger
+}
+
+// TieBreakMode selects how FindSchedulerClusters orders scheduler clusters
+// that Evaluate scores equally.
+type TieBreakMode int
+
+const (
+	// TieBreakScoreOnly keeps the score-sorted order as-is, leaving equally
+	// scored clusters in the order FilterSchedulerClusters produced them.
+	TieBreakScoreOnly TieBreakMode = iota
+
+	// TieBreakRendezvous orders equally scored clusters by an HRW
+	// (rendezvous) hash of the cluster name and client key, giving stable,
+	// evenly distributed affinity without coordination between callers.
+	TieBreakRendezvous
+)
+
+// scoreEpsilon is the tolerance within which two Evaluate scores are
+// considered tied for the purposes of tie-breaking.
+const scoreEpsilon = 1e-6
+
+// SearchOptions controls how FindSchedulerClusters breaks ties between
+// scheduler clusters that Evaluate scores equally.
+type SearchOptions struct {
+	// Client identifies the dfdaemon for rendezvous hashing. Defaults to
+	// hostname when empty, falling back to ip when hostname is also empty.
+	Client string
+
+	// TieBreak selects the tie-breaking strategy. Defaults to
+	// TieBreakScoreOnly.
+	TieBreak TieBreakMode
+}
+
+// clientKey resolves the client identity used for rendezvous hashing.
+func (o SearchOptions) clientKey(ip, hostname string) string {
+	if o.Client != "" {
+		return o.Client
+	}
+
+	if hostname != "" {
+		return hostname
+	}
+
+	return ip
+}
+
+// rendezvousScore returns the HRW (highest random weight) score of cluster
+// for clientKey: higher is more preferred.
+//
+// model.SchedulerCluster carries no per-cluster weight today, so unlike
+// classic weighted rendezvous hashing this always treats every cluster as
+// equally weighted. Add a Weight column/field (and the matching migration)
+// before reintroducing a weighted variant.
+func rendezvousScore(cluster model.SchedulerCluster, clientKey string) float64 {
+	return float64(xxhash.Sum64String(cluster.Name + "|" + clientKey))
+}
+
+// tieBreak reorders runs of clusters with equal (within scoreEpsilon) scores
+// by rendezvous hash, leaving the relative order between distinct score
+// buckets untouched.
+func tieBreak(scored []scoredCluster, ip, hostname string, opts SearchOptions) {
+	if opts.TieBreak == TieBreakScoreOnly || len(scored) < 2 {
+		return
+	}
+
+	client := opts.clientKey(ip, hostname)
+
+	start := 0
+	for i := 1; i <= len(scored); i++ {
+		if i < len(scored) && stdmath.Abs(scored[i].score-scored[start].score) < scoreEpsilon {
+			continue
+		}
+
+		bucket := scored[start:i]
+		if len(bucket) > 1 {
+			sort.Slice(bucket, func(a, b int) bool {
+				return rendezvousScore(bucket[a].cluster, client) > rendezvousScore(bucket[b].cluster, client)
+			})
+		}
+
+		start = i
+	}
 }
 
 type Searcher interface {
 	// FindSchedulerClusters finds scheduler clusters that best matches the evaluation.
-	FindSchedulerClusters(ctx context.Context, schedulerClusters []model.SchedulerCluster, ip, hostname string, conditions map[string]string) ([]model.SchedulerCluster, error)
+	FindSchedulerClusters(ctx context.Context, schedulerClusters []model.SchedulerCluster, ip, hostname string, conditions, labels map[string]string, opts SearchOptions) ([]model.SchedulerCluster, error)
 }
 
 type searcher struct {
@@ -104,40 +662,79 @@ func New(pluginDir string) Searcher {
 }
 
 // FindSchedulerClusters finds scheduler clusters that best matches the evaluation.
-func (s *searcher) FindSchedulerClusters(ctx context.Context, schedulerClusters []model.SchedulerCluster, ip, hostname string, conditions map[string]string) ([]model.SchedulerCluster, error) {
+func (s *searcher) FindSchedulerClusters(ctx context.Context, schedulerClusters []model.SchedulerCluster, ip, hostname string, conditions, labels map[string]string, opts SearchOptions) ([]model.SchedulerCluster, error) {
 	if len(schedulerClusters) <= 0 {
 		return nil, errors.New("empty scheduler clusters")
 	}
 
-	clusters := FilterSchedulerClusters(conditions, schedulerClusters)
-	if len(clusters) == 0 {
+	mergedLabels := mergeLabels(ip, hostname, conditions, labels)
+	candidates := filterSchedulerClusters(conditions, mergedLabels, schedulerClusters)
+	if len(candidates) == 0 {
 		return nil, fmt.Errorf("conditions %#v does not match any scheduler cluster", conditions)
 	}
 
-	sort.Slice(
-		clusters,
-		func(i, j int) bool {
-			var si, sj Scopes
-			if err := mapstructure.Decode(clusters[i].Scopes, &si); err != nil {
-				logger.Errorf("cluster %s decode scopes failed: %v", clusters[i].Name, err)
-				return false
-			}
+	// Decode each candidate's Scopes and score it exactly once, instead of
+	// letting sort.Slice's less-func decode and score the same clusters
+	// repeatedly.
+	scored := make([]scoredCluster, 0, len(candidates))
+	for _, candidate := range candidates {
+		scopes, _, err := globalClusterCache.get(candidate.cluster.Name, candidate.rawScopes)
+		if err != nil {
+			logger.Errorf("cluster %s decode scopes failed: %v", candidate.cluster.Name, err)
+			continue
+		}
 
-			if err := mapstructure.Decode(clusters[j].Scopes, &sj); err != nil {
-				logger.Errorf("cluster %s decode scopes failed: %v", clusters[i].Name, err)
-				return false
-			}
+		scored = append(scored, scoredCluster{
+			cluster: candidate.cluster,
+			score:   Evaluate(ip, hostname, conditions, mergedLabels, scopes, candidate.ranger, candidate.cluster),
+		})
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
 
-			return Evaluate(ip, hostname, conditions, si, clusters[i]) > Evaluate(ip, hostname, conditions, sj, clusters[j])
-		},
-	)
+	tieBreak(scored, ip, hostname, opts)
+
+	clusters := make([]model.SchedulerCluster, len(scored))
+	for i, sc := range scored {
+		clusters[i] = sc.cluster
+	}
 
 	return clusters, nil
 }
 
+// scoredCluster pairs a scheduler cluster with its Evaluate score.
+type scoredCluster struct {
+	cluster model.SchedulerCluster
+	score   float64
+}
+
+// filteredCluster pairs a scheduler cluster that passed filtering with its
+// raw Scopes map and pre-built CIDR ranger, so that FindSchedulerClusters
+// does not need to decode Scopes or rebuild the ranger a second time.
+type filteredCluster struct {
+	cluster   model.SchedulerCluster
+	rawScopes map[string]interface{}
+	ranger    cidranger.Ranger
+}
+
 // Filter the scheduler clusters that dfdaemon can be used.
-func FilterSchedulerClusters(conditions map[string]string, schedulerClusters []model.SchedulerCluster) []model.SchedulerCluster {
+func FilterSchedulerClusters(conditions, labels map[string]string, schedulerClusters []model.SchedulerCluster) []model.SchedulerCluster {
 	var clusters []model.SchedulerCluster
+	for _, filtered := range filterSchedulerClusters(conditions, labels, schedulerClusters) {
+		clusters = append(clusters, filtered.cluster)
+	}
+
+	return clusters
+}
+
+// filterSchedulerClusters is the implementation behind FilterSchedulerClusters.
+// It additionally returns each surviving cluster's raw Scopes and memoized
+// CIDR ranger so callers that go on to score the clusters do not have to
+// decode Scopes or rebuild the ranger again.
+func filterSchedulerClusters(conditions, labels map[string]string, schedulerClusters []model.SchedulerCluster) []filteredCluster {
+	var clusters []filteredCluster
 	securityDomain := conditions[ConditionSecurityDomain]
 	for _, schedulerCluster := range schedulerClusters {
 		// There are no active schedulers in the scheduler cluster
@@ -145,21 +742,44 @@ func FilterSchedulerClusters(conditions map[string]string, schedulerClusters []m
 			continue
 		}
 
+		rawScopes, _ := schedulerCluster.Scopes.(map[string]interface{})
+		scopes, ranger, err := globalClusterCache.get(schedulerCluster.Name, rawScopes)
+		if err != nil {
+			logger.Errorf("cluster %s decode scopes failed: %v", schedulerCluster.Name, err)
+			continue
+		}
+
+		matched := true
+		for _, selector := range scopes.filterSelectors() {
+			if !selector.match(labels) {
+				matched = false
+				break
+			}
+		}
+
+		if !matched {
+			continue
+		}
+
+		add := func() {
+			clusters = append(clusters, filteredCluster{cluster: schedulerCluster, rawScopes: rawScopes, ranger: ranger})
+		}
+
 		// Dfdaemon security_domain does not exist, matching all scheduler clusters
 		if securityDomain == "" {
-			clusters = append(clusters, schedulerCluster)
+			add()
 			continue
 		}
 
 		// Scheduler cluster is default, matching all dfdaemons
 		if schedulerCluster.IsDefault {
-			clusters = append(clusters, schedulerCluster)
+			add()
 			continue
 		}
 
 		// Scheduler cluster SecurityRules does not exist, matching all dfdaemons
 		if len(schedulerCluster.SecurityGroup.SecurityRules) == 0 {
-			clusters = append(clusters, schedulerCluster)
+			add()
 			continue
 		}
 
@@ -168,7 +788,7 @@ func FilterSchedulerClusters(conditions map[string]string, schedulerClusters []m
 		// then security_domain and SecurityRules are equal to match.
 		for _, securityRule := range schedulerCluster.SecurityGroup.SecurityRules {
 			if strings.EqualFold(securityRule.Domain, securityDomain) {
-				clusters = append(clusters, schedulerCluster)
+				add()
 			}
 		}
 	}
@@ -177,14 +797,38 @@ func FilterSchedulerClusters(conditions map[string]string, schedulerClusters []m
 }
 
 // Evaluate the degree of matching between scheduler cluster and dfdaemon.
-func Evaluate(ip, hostname string, conditions map[string]string, scopes Scopes, cluster model.SchedulerCluster) float64 {
+func Evaluate(ip, hostname string, conditions, labels map[string]string, scopes Scopes, ranger cidranger.Ranger, cluster model.SchedulerCluster) float64 {
 	return securityDomainAffinityWeight*calculateSecurityDomainAffinityScore(conditions[ConditionSecurityDomain], cluster.SecurityGroup.SecurityRules) +
-		cidrAffinityWeight*calculateCIDRAffinityScore(ip, scopes.CIDRs) +
+		cidrAffinityWeight*calculateCIDRAffinityScore(ip, ranger) +
 		idcAffinityWeight*calculateIDCAffinityScore(conditions[ConditionIDC], scopes.IDC) +
-		locationAffinityWeight*calculateMultiElementAffinityScore(conditions[ConditionLocation], scopes.Location) +
+		locationAffinityWeight*calculateLocationAffinityScore(ip, conditions[ConditionLocation], scopes) +
+		labelSelectorAffinityWeight*calculateLabelSelectorAffinityScore(labels, scopes.filterSelectors()) +
 		clusterTypeWeight*calculateClusterTypeScore(cluster)
 }
 
+// calculateLabelSelectorAffinityScore 0.0~1.0 larger and better. It is the
+// ratio of the weight of matched selectors to the total selector weight.
+func calculateLabelSelectorAffinityScore(labels map[string]string, selectors []MatchExpression) float64 {
+	if len(selectors) == 0 {
+		return minScore
+	}
+
+	var matchedWeight, totalWeight float64
+	for _, selector := range selectors {
+		w := selector.weight()
+		totalWeight += w
+		if selector.match(labels) {
+			matchedWeight += w
+		}
+	}
+
+	if totalWeight == 0 {
+		return minScore
+	}
+
+	return matchedWeight / totalWeight
+}
+
 // calculateSecurityDomainAffinityScore 0.0~1.0 larger and better.
 func calculateSecurityDomainAffinityScore(securityDomain string, securityRules []model.SecurityRule) float64 {
 	if securityDomain == "" {
@@ -198,21 +842,11 @@ func calculateSecurityDomainAffinityScore(securityDomain string, securityRules [
 	return maxScore
 }
 
-// calculateCIDRAffinityScore 0.0~1.0 larger and better.
-func calculateCIDRAffinityScore(ip string, cidrs []string) float64 {
-	// Construct CIDR ranger.
-	ranger := cidranger.NewPCTrieRanger()
-	for _, cidr := range cidrs {
-		_, network, err := net.ParseCIDR(cidr)
-		if err != nil {
-			logger.Error(err)
-			continue
-		}
-
-		if err := ranger.Insert(cidranger.NewBasicRangerEntry(*network)); err != nil {
-			logger.Error(err)
-			continue
-		}
+// calculateCIDRAffinityScore 0.0~1.0 larger and better. ranger is memoized
+// per scheduler cluster by clusterCache, so callers must not rebuild it here.
+func calculateCIDRAffinityScore(ip string, ranger cidranger.Ranger) float64 {
+	if ranger == nil {
+		return minScore
 	}
 
 	// Determine whether an IP is contained in the constructed networks ranger.
@@ -0,0 +1,365 @@
+/*
+ *     Copyright 2020 The Dragonfly Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package searcher
+
+import (
+	"context"
+	"fmt"
+	stdmath "math"
+	"testing"
+
+	"d7y.io/dragonfly/v2/manager/model"
+)
+
+// benchmarkSchedulerClusters builds n scheduler clusters, each with cidrsPerCluster CIDRs in its Scopes.
+func benchmarkSchedulerClusters(n, cidrsPerCluster int) []model.SchedulerCluster {
+	clusters := make([]model.SchedulerCluster, n)
+	for i := 0; i < n; i++ {
+		cidrs := make([]string, cidrsPerCluster)
+		for j := 0; j < cidrsPerCluster; j++ {
+			cidrs[j] = fmt.Sprintf("10.%d.%d.0/24", i%256, j%256)
+		}
+
+		clusters[i] = model.SchedulerCluster{
+			Name:       fmt.Sprintf("cluster-%d", i),
+			IsDefault:  false,
+			Schedulers: []model.Scheduler{{}},
+			Scopes: map[string]interface{}{
+				"idc":      "idc-1",
+				"location": "country|province|city",
+				"cidrs":    cidrs,
+			},
+		}
+	}
+
+	return clusters
+}
+
+func BenchmarkFindSchedulerClusters_1000Clusters_100CIDRs(b *testing.B) {
+	clusters := benchmarkSchedulerClusters(1000, 100)
+	s := &searcher{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.FindSchedulerClusters(context.Background(), clusters, "10.0.0.1", "host", nil, nil, SearchOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindSchedulerClusters_10000Clusters_100CIDRs(b *testing.B) {
+	clusters := benchmarkSchedulerClusters(10000, 100)
+	s := &searcher{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.FindSchedulerClusters(context.Background(), clusters, "10.0.0.1", "host", nil, nil, SearchOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMatchExpression_match(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     MatchExpression
+		labels   map[string]string
+		expected bool
+	}{
+		{
+			name:     "In matches one of the values",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorIn, Values: []string{"idc-1", "idc-2"}},
+			labels:   map[string]string{"idc": "idc-2"},
+			expected: true,
+		},
+		{
+			name:     "In does not match when key is absent",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorIn, Values: []string{"idc-1"}},
+			labels:   map[string]string{},
+			expected: false,
+		},
+		{
+			name:     "NotIn matches when key is absent",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorNotIn, Values: []string{"idc-1"}},
+			labels:   map[string]string{},
+			expected: true,
+		},
+		{
+			name:     "NotIn does not match one of the values",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorNotIn, Values: []string{"idc-1"}},
+			labels:   map[string]string{"idc": "idc-1"},
+			expected: false,
+		},
+		{
+			name:     "Exists matches when key is present",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorExists},
+			labels:   map[string]string{"idc": ""},
+			expected: true,
+		},
+		{
+			name:     "Exists does not match when key is absent",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorExists},
+			labels:   map[string]string{},
+			expected: false,
+		},
+		{
+			name:     "DoesNotExist matches when key is absent",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorDoesNotExist},
+			labels:   map[string]string{},
+			expected: true,
+		},
+		{
+			name:     "DoesNotExist does not match when key is present",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorDoesNotExist},
+			labels:   map[string]string{"idc": "idc-1"},
+			expected: false,
+		},
+		{
+			name:     "Matches matches an anchored regexp",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorMatches, Values: []string{"idc-[0-9]+"}},
+			labels:   map[string]string{"idc": "idc-1"},
+			expected: true,
+		},
+		{
+			name:     "Matches does not match a partial overlap",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorMatches, Values: []string{"idc-[0-9]+"}},
+			labels:   map[string]string{"idc": "xidc-1x"},
+			expected: false,
+		},
+		{
+			name:     "DoesNotMatch matches when key is absent",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorDoesNotMatch, Values: []string{"idc-[0-9]+"}},
+			labels:   map[string]string{},
+			expected: true,
+		},
+		{
+			name:     "DoesNotMatch does not match a matching value",
+			expr:     MatchExpression{Key: "idc", Operator: OperatorDoesNotMatch, Values: []string{"idc-[0-9]+"}},
+			labels:   map[string]string{"idc": "idc-1"},
+			expected: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expr := tc.expr
+			if err := expr.compile(); err != nil {
+				t.Fatalf("compile() error = %v", err)
+			}
+
+			if got := expr.match(tc.labels); got != tc.expected {
+				t.Errorf("match() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMatchExpression_compile(t *testing.T) {
+	expr := MatchExpression{Key: "idc", Operator: OperatorMatches, Values: []string{"idc-[0-9]+"}}
+	if err := expr.compile(); err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+
+	compiled := expr.regex
+	if compiled == nil {
+		t.Fatal("compile() left regex nil")
+	}
+
+	// A second compile() call must not recompile an already-compiled
+	// expression, so that clusterCache.get compiling a selector once stays
+	// a one-time cost.
+	if err := expr.compile(); err != nil {
+		t.Fatalf("second compile() error = %v", err)
+	}
+
+	if expr.regex != compiled {
+		t.Error("second compile() replaced an already-compiled regexp")
+	}
+}
+
+func TestMatchExpression_weight(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     MatchExpression
+		expected float64
+	}{
+		{
+			name:     "zero weight defaults to 1",
+			expr:     MatchExpression{},
+			expected: 1,
+		},
+		{
+			name:     "explicit weight is preserved",
+			expr:     MatchExpression{Weight: 2.5},
+			expected: 2.5,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.expr.weight(); got != tc.expected {
+				t.Errorf("weight() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestScopes_filterSelectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   Scopes
+		expected int
+	}{
+		{
+			name:     "no explicit selectors never falls back to legacy idc/location",
+			scopes:   Scopes{IDC: "idc-1", Location: "country|province|city"},
+			expected: 0,
+		},
+		{
+			name: "explicit selectors are returned as-is",
+			scopes: Scopes{
+				IDC:       "idc-1",
+				Selectors: []MatchExpression{{Key: "idc", Operator: OperatorIn, Values: []string{"idc-1"}}},
+			},
+			expected: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := len(tc.scopes.filterSelectors()); got != tc.expected {
+				t.Errorf("filterSelectors() returned %d selectors, want %d", got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestEvaluate_LegacyClusterScoreUnaffectedBySelectors is a regression test
+// for a cluster that predates the label selector feature and never
+// configures Scopes.Selectors: it must score exactly as it did before
+// calculateLabelSelectorAffinityScore existed, i.e. the selector term
+// contributes nothing and idc/location are only scored once each, not twice.
+func TestEvaluate_LegacyClusterScoreUnaffectedBySelectors(t *testing.T) {
+	cluster := model.SchedulerCluster{Name: "legacy-cluster"}
+	scopes := Scopes{IDC: "idc-1", Location: "country|province|city"}
+	conditions := map[string]string{ConditionIDC: "idc-1", ConditionLocation: "country|province|city"}
+	labels := mergeLabels("", "", conditions, nil)
+
+	got := Evaluate("", "", conditions, labels, scopes, nil, cluster)
+	want := idcAffinityWeight*maxScore + locationAffinityWeight*maxScore
+	if stdmath.Abs(got-want) > scoreEpsilon {
+		t.Errorf("Evaluate() = %v, want %v (idc/location scored once each, no selector double-count)", got, want)
+	}
+}
+
+// TestTieBreak_Rendezvous verifies that clusters tied within scoreEpsilon are
+// reordered deterministically by rendezvous hash of the client key, while
+// clusters in distinct score buckets keep their relative order.
+func TestTieBreak_Rendezvous(t *testing.T) {
+	a := model.SchedulerCluster{Name: "cluster-a"}
+	b := model.SchedulerCluster{Name: "cluster-b"}
+	c := model.SchedulerCluster{Name: "cluster-c"}
+
+	newScored := func() []scoredCluster {
+		return []scoredCluster{
+			{cluster: a, score: 0.5},
+			{cluster: b, score: 0.5},
+			{cluster: c, score: 0.3},
+		}
+	}
+
+	opts := SearchOptions{TieBreak: TieBreakRendezvous, Client: "client-1"}
+
+	first := newScored()
+	tieBreak(first, "", "", opts)
+
+	// The untied cluster-c must stay last regardless of the tie-break.
+	if first[2].cluster.Name != "cluster-c" {
+		t.Fatalf("tieBreak() reordered the untied bucket: got %+v", first)
+	}
+
+	// Re-running tieBreak for the same client must reproduce the same order.
+	second := newScored()
+	tieBreak(second, "", "", opts)
+	for i := range first {
+		if first[i].cluster.Name != second[i].cluster.Name {
+			t.Fatalf("tieBreak() is not deterministic for the same client: %+v vs %+v", first, second)
+		}
+	}
+
+	// The tied bucket order must match rendezvousScore's own ranking.
+	want := []string{"cluster-a", "cluster-b"}
+	if rendezvousScore(b, opts.Client) > rendezvousScore(a, opts.Client) {
+		want = []string{"cluster-b", "cluster-a"}
+	}
+
+	got := []string{first[0].cluster.Name, first[1].cluster.Name}
+	if got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("tieBreak() tied bucket = %v, want %v", got, want)
+	}
+}
+
+// TestTieBreak_ScoreOnly verifies that TieBreakScoreOnly leaves the
+// score-sorted order untouched, even when scores are tied.
+func TestTieBreak_ScoreOnly(t *testing.T) {
+	a := model.SchedulerCluster{Name: "cluster-a"}
+	b := model.SchedulerCluster{Name: "cluster-b"}
+	scored := []scoredCluster{
+		{cluster: a, score: 0.5},
+		{cluster: b, score: 0.5},
+	}
+
+	tieBreak(scored, "", "", SearchOptions{TieBreak: TieBreakScoreOnly})
+
+	if scored[0].cluster.Name != "cluster-a" || scored[1].cluster.Name != "cluster-b" {
+		t.Errorf("tieBreak() with TieBreakScoreOnly reordered clusters: %+v", scored)
+	}
+}
+
+func TestCalculateLocationAffinityScore(t *testing.T) {
+	t.Run("falls back to string-token score when scopes lack coordinates", func(t *testing.T) {
+		location := "country|province|city"
+		scopes := Scopes{Location: "country|province|other", Latitude: stdmath.NaN(), Longitude: stdmath.NaN()}
+
+		got := calculateLocationAffinityScore("", location, scopes)
+		want := calculateMultiElementAffinityScore(location, scopes.Location)
+		if got != want {
+			t.Errorf("calculateLocationAffinityScore() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("uses haversine distance when both sides provide coordinates", func(t *testing.T) {
+		// San Francisco to Los Angeles.
+		location := "geo:37.7749,-122.4194"
+		scopes := Scopes{Latitude: 34.0522, Longitude: -118.2437}
+
+		got := calculateLocationAffinityScore("", location, scopes)
+		distance := haversineKm(37.7749, -122.4194, scopes.Latitude, scopes.Longitude)
+		want := maxScore - stdmath.Min(distance/MaxGeoDistanceKm(), maxScore)
+		if stdmath.Abs(got-want) > scoreEpsilon {
+			t.Errorf("calculateLocationAffinityScore() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("(0, 0) is treated as a real coordinate, not a missing one", func(t *testing.T) {
+		location := "geo:0,0"
+		scopes := Scopes{Latitude: 0, Longitude: 0}
+
+		got := calculateLocationAffinityScore("", location, scopes)
+		if stdmath.Abs(got-maxScore) > scoreEpsilon {
+			t.Errorf("calculateLocationAffinityScore() = %v, want %v (zero distance between two (0,0) coordinates)", got, maxScore)
+		}
+	})
+}